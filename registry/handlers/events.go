@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/registry/index"
+	"github.com/gorilla/handlers"
+)
+
+// eventsDispatcher constructs the /index/events audit-trail endpoint.
+func eventsDispatcher(ctx *Context, r *http.Request) http.Handler {
+	eventsHandler := &eventsHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(eventsHandler.GetEvents),
+	}
+}
+
+// eventsHandler serves the persisted registry index event history,
+// mirroring the semantics of Docker's /events API but scoped to index
+// changes (the manifest push, pull and delete notifications the index
+// observes; tag status updates are not recorded).
+type eventsHandler struct {
+	*Context
+}
+
+func (eh *eventsHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	args, err := parseEventQueryArgs(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		eh.streamEvents(w, r, args)
+		return
+	}
+
+	events, err := eh.index.Events(args)
+	if err != nil {
+		eh.Errors.PushErr(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(events)
+}
+
+func (eh *eventsHandler) streamEvents(w http.ResponseWriter, r *http.Request, args index.EventQueryArgs) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	backlog, err := eh.index.Events(args)
+	if err != nil {
+		eh.Errors.PushErr(err)
+		return
+	}
+	for _, event := range backlog {
+		writeSSE(w, event)
+	}
+	flusher.Flush()
+
+	updates, cancel := eh.index.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case event, ok := <-updates:
+			if !ok {
+				return
+			}
+			writeSSE(w, event)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event index.Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "data: %s\n\n", payload)
+}
+
+// parseEventQueryArgs reads ?since=&until=&filter=key=value,key=value,
+// accepting unix or RFC3339 timestamps, matching the format operators
+// already use against `docker events`.
+func parseEventQueryArgs(r *http.Request) (index.EventQueryArgs, error) {
+	var args index.EventQueryArgs
+
+	var err error
+	if since := r.Form.Get("since"); since != "" {
+		if args.Since, err = parseEventTime(since); err != nil {
+			return args, fmt.Errorf("invalid since: %v", err)
+		}
+	}
+	if until := r.Form.Get("until"); until != "" {
+		if args.Until, err = parseEventTime(until); err != nil {
+			return args, fmt.Errorf("invalid until: %v", err)
+		}
+	}
+
+	for _, pair := range strings.Split(r.Form.Get("filter"), ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "repository":
+			args.Repository = kv[1]
+		case "action":
+			args.Action = kv[1]
+		}
+	}
+
+	return args, nil
+}
+
+func parseEventTime(value string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -34,9 +34,10 @@ func (ih *indexHandler) GetPage(w http.ResponseWriter, r *http.Request) {
 	limit, _ := strconv.Atoi(r.Form.Get("limit"))
 	keyword := r.Form.Get("keyword")
 	queryArgs := index.QueryArgs{
-		Keyword: keyword,
-		Skip:    skip,
-		Limit:   limit,
+		Keyword:  keyword,
+		Skip:     skip,
+		Limit:    limit,
+		Platform: r.Form.Get("platform"),
 	}
 
 	page, err := ih.index.GetPage(queryArgs)
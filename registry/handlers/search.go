@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/handlers"
+)
+
+const searchPageSize = 25
+
+// searchDispatcher constructs the docker-registry v1 compatible /v1/search
+// endpoint, backed by the index's FTS5 ranking on sqlite stores. Postgres
+// and mysql stores, and an empty query, use a LIKE scan instead.
+func searchDispatcher(ctx *Context, r *http.Request) http.Handler {
+	searchHandler := &searchHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(searchHandler.Search),
+	}
+}
+
+type searchHandler struct {
+	*Context
+}
+
+// searchResponse matches the shape `docker search` expects back from a
+// v1 registry.
+type searchResponse struct {
+	NumPages   int                    `json:"num_pages"`
+	NumResults int                    `json:"num_results"`
+	Page       int                    `json:"page"`
+	PageSize   int                    `json:"page_size"`
+	Query      string                 `json:"query"`
+	Results    []searchResultResponse `json:"results"`
+}
+
+type searchResultResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	IsOfficial  bool   `json:"is_official"`
+	IsAutomated bool   `json:"is_automated"`
+	StarCount   int    `json:"star_count"`
+}
+
+func (sh *searchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	query := r.Form.Get("q")
+	page, _ := strconv.Atoi(r.Form.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(r.Form.Get("n"))
+	if pageSize < 1 {
+		pageSize = searchPageSize
+	}
+
+	results, total, err := sh.index.Search(query, page, pageSize)
+	if err != nil {
+		sh.Errors.PushErr(err)
+		return
+	}
+
+	resp := searchResponse{
+		NumPages:   (total + pageSize - 1) / pageSize,
+		NumResults: total,
+		Page:       page,
+		PageSize:   pageSize,
+		Query:      query,
+	}
+	for _, result := range results {
+		resp.Results = append(resp.Results, searchResultResponse{
+			Name:        result.Name,
+			Description: result.Description,
+			IsOfficial:  result.IsOfficial,
+			IsAutomated: result.IsAutomated,
+			StarCount:   result.StarCount,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 
 	"github.com/gorilla/handlers"
@@ -16,6 +18,7 @@ func tagStatusDispatcher(ctx *Context, r *http.Request) http.Handler {
 
 	return handlers.MethodHandler{
 		"PATCH": http.HandlerFunc(tagStatusHandler.SetTagStatus),
+		"GET":   http.HandlerFunc(tagStatusHandler.GetTagStatus),
 	}
 }
 
@@ -24,14 +27,38 @@ type tagStatusHandler struct {
 	*Context
 }
 
+// SetTagStatus records a CI/CD integration's view of a tag. Callers sign
+// the request with X-Registry-Signature/X-Registry-Timestamp once
+// index.webhook_secret (or a per-context override in index.webhook_secrets)
+// is configured, so only trusted pipelines can flip a tag's status.
 func (th *tagStatusHandler) SetTagStatus(w http.ResponseWriter, r *http.Request) {
-	req := make(map[string]string)
-	err := json.NewDecoder(r.Body).Decode(&req)
+	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), 400)
 		return
 	}
-	err = th.index.SetTagStatus(req["repository"], req["tag"], req["status"], req["description"], req["target_url"])
+
+	req := make(map[string]string)
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	context := req["context"]
+	if context == "" {
+		context = "default"
+	}
+
+	if th.index.WebhookSecretConfigured(context) {
+		sig := r.Header.Get("X-Registry-Signature")
+		ts := r.Header.Get("X-Registry-Timestamp")
+		if err := th.index.VerifyWebhookSignature(context, sig, ts, body); err != nil {
+			http.Error(w, err.Error(), 401)
+			return
+		}
+	}
+
+	err = th.index.SetTagStatusContext(req["repository"], req["tag"], context, req["status"], req["description"], req["target_url"])
 	if err == sql.ErrNoRows {
 		http.Error(w, err.Error(), 404)
 		return
@@ -42,3 +69,20 @@ func (th *tagStatusHandler) SetTagStatus(w http.ResponseWriter, r *http.Request)
 	}
 	w.WriteHeader(204)
 }
+
+// GetTagStatus lets CI systems poll the current status tuples attached to
+// a tag across all integration contexts.
+func (th *tagStatusHandler) GetTagStatus(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	repository := r.Form.Get("repository")
+	tag := r.Form.Get("tag")
+
+	statuses, err := th.index.TagStatuses(repository, tag)
+	if err != nil {
+		th.Errors.PushErr(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(statuses)
+}
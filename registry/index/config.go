@@ -0,0 +1,39 @@
+package index
+
+import "time"
+
+// Config is the index service's own configuration. It is deliberately a
+// separate struct passed into New rather than a block hung off
+// configuration.Configuration: that type belongs to a different package
+// this service doesn't own, so giving the index store, event retention
+// and webhook signing their own settings doesn't require changing it.
+// Callers construct Config from whatever "index:" section they parse out
+// of the registry config file and pass it alongside the rest of the
+// shared configuration.
+type Config struct {
+	// Driver/DSN select and connect to the index's own SQL store
+	// (sqlite3/postgres/mysql). Driver defaults to "sqlite3" and DSN to a
+	// registry.sqlite3 file under the storage root directory when unset.
+	Driver string
+	DSN    string
+
+	// MaxOpenConns/MaxIdleConns override the driver's default connection
+	// pool sizing when positive.
+	MaxOpenConns int
+	MaxIdleConns int
+
+	// MaxRetries/RetryBackoff tune the enrichment worker pool's retry
+	// behaviour on 5xx/429 responses from the registry's own HTTP API.
+	MaxRetries   int
+	RetryBackoff time.Duration
+
+	// WebhookSecret is the default HMAC secret tag-status PATCH requests
+	// are verified against; WebhookSecrets overrides it per integration,
+	// keyed by the same "context" value the integration PATCHes under.
+	WebhookSecret  string
+	WebhookSecrets map[string]string
+
+	// EventRetention is how long persisted /index/events rows are kept
+	// before the retention sweeper prunes them. Defaults to 30 days.
+	EventRetention time.Duration
+}
@@ -0,0 +1,292 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/distribution/configuration"
+)
+
+const (
+	enrichWorkers       = 4
+	enrichQueueSize     = 256
+	defaultMaxRetry     = 5
+	defaultRetryBackoff = 200 * time.Millisecond
+)
+
+// enricher fetches manifest metadata for newly-pushed tags off the
+// notification path, so Write never blocks on the registry's own HTTP
+// API. Jobs are processed by a small worker pool with retry on 5xx/429,
+// tuned by index.max_retries/index.retry_backoff. The same pool expands
+// manifest-list/OCI-index pushes into per-platform rows, for the same
+// reason.
+type enricher struct {
+	service      *IndexService
+	client       *http.Client
+	baseURL      string
+	jobs         chan Tag
+	listJobs     chan manifestListJob
+	done         chan struct{}
+	maxRetry     int
+	retryBackoff time.Duration
+}
+
+func newEnricher(service *IndexService, config *configuration.Configuration, indexConfig Config) *enricher {
+	maxRetry := indexConfig.MaxRetries
+	if maxRetry <= 0 {
+		maxRetry = defaultMaxRetry
+	}
+	retryBackoff := indexConfig.RetryBackoff
+	if retryBackoff <= 0 {
+		retryBackoff = defaultRetryBackoff
+	}
+
+	e := &enricher{
+		service:      service,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		baseURL:      registryBaseURL(config),
+		jobs:         make(chan Tag, enrichQueueSize),
+		listJobs:     make(chan manifestListJob, enrichQueueSize),
+		done:         make(chan struct{}),
+		maxRetry:     maxRetry,
+		retryBackoff: retryBackoff,
+	}
+	for i := 0; i < enrichWorkers; i++ {
+		go e.worker()
+	}
+	return e
+}
+
+func registryBaseURL(config *configuration.Configuration) string {
+	if config.HTTP.Addr != "" {
+		return "http://" + config.HTTP.Addr
+	}
+	return "http://localhost:5000"
+}
+
+func (e *enricher) enqueue(tag Tag) {
+	select {
+	case e.jobs <- tag:
+	default:
+		logrus.Warn("index: enrichment queue full, dropping job for ", tag.Repository, ":", tag.Tag)
+	}
+}
+
+func (e *enricher) enqueueList(job manifestListJob) {
+	select {
+	case e.listJobs <- job:
+	default:
+		logrus.Warn("index: enrichment queue full, dropping manifest list job for ", job.repository, ":", job.tag)
+	}
+}
+
+func (e *enricher) stop() {
+	close(e.done)
+}
+
+func (e *enricher) worker() {
+	for {
+		select {
+		case tag := <-e.jobs:
+			e.process(tag)
+		case job := <-e.listJobs:
+			e.processList(job)
+		case <-e.done:
+			return
+		}
+	}
+}
+
+func (e *enricher) process(tag Tag) {
+	enriched, err := e.fetchWithRetry(tag)
+	if err != nil {
+		logrus.Error("index: failed to enrich ", tag.Repository, ":", tag.Tag, ": ", err)
+		return
+	}
+
+	if err := e.service.store.UpdateEnrichment(enriched); err != nil {
+		logrus.Error("index: failed to persist enrichment for ", tag.Repository, ":", tag.Tag, ": ", err)
+	}
+}
+
+func (e *enricher) fetchWithRetry(tag Tag) (Tag, error) {
+	var lastErr error
+	for attempt := 0; attempt < e.maxRetry; attempt++ {
+		if attempt > 0 {
+			time.Sleep(e.backoff(attempt))
+		}
+
+		enriched, retryable, err := e.fetch(tag)
+		if err == nil {
+			return enriched, nil
+		}
+		lastErr = err
+		if !retryable {
+			break
+		}
+	}
+	return tag, lastErr
+}
+
+func (e *enricher) backoff(attempt int) time.Duration {
+	return time.Duration(attempt*attempt) * e.retryBackoff
+}
+
+func (e *enricher) fetch(tag Tag) (Tag, bool, error) {
+	url := fmt.Sprintf("%s/v2/%s/manifests/%s", e.baseURL, tag.Repository, manifestReference(tag))
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return tag, false, err
+	}
+	req.Header.Set("Accept",
+		"application/vnd.docker.distribution.manifest.v2+json, application/vnd.docker.distribution.manifest.v1+prettyjws")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return tag, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return tag, true, fmt.Errorf("index: manifest fetch for %s:%s returned %d", tag.Repository, tag.Tag, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return tag, false, fmt.Errorf("index: manifest fetch for %s:%s returned %d", tag.Repository, tag.Tag, resp.StatusCode)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	switch contentType {
+	case "application/vnd.docker.distribution.manifest.v2+json", "application/vnd.oci.image.manifest.v1+json":
+		return parseSchema2(e.client, e.baseURL, tag, resp.Body, contentType)
+	default:
+		return parseSchema1(tag, resp.Body)
+	}
+}
+
+// manifestReference prefers the tag itself, falling back to the digest
+// when there is no tag or the job is a manifest-list child: children carry
+// their parent list's tag (so the row matches on repository/tag/platform)
+// but must always be fetched by their own digest, since GETing the tag
+// would re-fetch the manifest list itself rather than this child manifest.
+func manifestReference(tag Tag) string {
+	if tag.Tag != "" && !tag.listChild {
+		return tag.Tag
+	}
+	return tag.Digest
+}
+
+// schema1Manifest is the minimal slice of a signed schema1 manifest we
+// need: the first (newest) history entry's v1Compatibility JSON carries
+// the architecture/os/created/author fields.
+type schema1Manifest struct {
+	Architecture string `json:"architecture"`
+	History      []struct {
+		V1Compatibility string `json:"v1Compatibility"`
+	} `json:"history"`
+}
+
+type v1Compatibility struct {
+	Created      time.Time `json:"created"`
+	Author       string    `json:"author"`
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+}
+
+func parseSchema1(tag Tag, body io.Reader) (Tag, bool, error) {
+	var manifest schema1Manifest
+	if err := json.NewDecoder(body).Decode(&manifest); err != nil {
+		return tag, false, err
+	}
+
+	tag.Architecture = manifest.Architecture
+	tag.MediaType = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+
+	if len(manifest.History) > 0 {
+		var v1c v1Compatibility
+		if err := json.Unmarshal([]byte(manifest.History[0].V1Compatibility), &v1c); err == nil {
+			tag.OS = v1c.OS
+			tag.Author = v1c.Author
+			tag.Created = v1c.Created
+			if tag.Architecture == "" {
+				tag.Architecture = v1c.Architecture
+			}
+		}
+	}
+	return tag, false, nil
+}
+
+// schema2Manifest is the config+layers shape shared by Docker v2 and OCI
+// image manifests.
+type schema2Manifest struct {
+	Config struct {
+		Digest string `json:"digest"`
+		Size   int64  `json:"size"`
+	} `json:"config"`
+	Layers []struct {
+		Digest string `json:"digest"`
+		Size   int64  `json:"size"`
+	} `json:"layers"`
+}
+
+type schema2Config struct {
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+	Author       string    `json:"author"`
+	Created      time.Time `json:"created"`
+}
+
+func parseSchema2(client *http.Client, baseURL string, tag Tag, body io.Reader, mediaType string) (Tag, bool, error) {
+	var manifest schema2Manifest
+	if err := json.NewDecoder(body).Decode(&manifest); err != nil {
+		return tag, false, err
+	}
+
+	tag.MediaType = mediaType
+	tag.Size = manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		tag.Layers = append(tag.Layers, LayerInfo{Digest: layer.Digest, Size: layer.Size})
+		tag.Size += layer.Size
+	}
+
+	config, retryable, err := fetchConfigBlob(client, baseURL, tag.Repository, manifest.Config.Digest)
+	if err != nil {
+		return tag, retryable, err
+	}
+
+	tag.Architecture = config.Architecture
+	tag.OS = config.OS
+	tag.Author = config.Author
+	tag.Created = config.Created
+	return tag, false, nil
+}
+
+func fetchConfigBlob(client *http.Client, baseURL, repository, digest string) (schema2Config, bool, error) {
+	var config schema2Config
+	if digest == "" {
+		return config, false, nil
+	}
+
+	url := fmt.Sprintf("%s/v2/%s/blobs/%s", baseURL, repository, digest)
+	resp, err := client.Get(url)
+	if err != nil {
+		return config, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return config, true, fmt.Errorf("index: config blob fetch for %s returned %d", repository, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return config, false, fmt.Errorf("index: config blob fetch for %s returned %d", repository, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return config, false, err
+	}
+	return config, true, nil
+}
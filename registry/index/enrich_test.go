@@ -0,0 +1,99 @@
+package index
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManifestReferencePrefersTag(t *testing.T) {
+	tag := Tag{Tag: "latest", Digest: "sha256:abc"}
+	if got := manifestReference(tag); got != "latest" {
+		t.Fatalf("manifestReference: got %q, want %q", got, "latest")
+	}
+}
+
+func TestManifestReferenceFallsBackToDigestWithoutTag(t *testing.T) {
+	tag := Tag{Digest: "sha256:abc"}
+	if got := manifestReference(tag); got != "sha256:abc" {
+		t.Fatalf("manifestReference: got %q, want %q", got, "sha256:abc")
+	}
+}
+
+func TestManifestReferenceUsesDigestForListChildren(t *testing.T) {
+	tag := Tag{Tag: "latest", Digest: "sha256:child", listChild: true}
+	if got := manifestReference(tag); got != "sha256:child" {
+		t.Fatalf("manifestReference: got %q, want %q", got, "sha256:child")
+	}
+}
+
+func TestParseSchema1(t *testing.T) {
+	body := strings.NewReader(`{
+		"architecture": "amd64",
+		"history": [
+			{"v1Compatibility": "{\"created\":\"2020-01-02T03:04:05Z\",\"author\":\"someone\",\"os\":\"linux\"}"}
+		]
+	}`)
+
+	tag, retryable, err := parseSchema1(Tag{Repository: "library/alpine", Tag: "latest"}, body)
+	if err != nil {
+		t.Fatalf("parseSchema1: %v", err)
+	}
+	if retryable {
+		t.Fatal("parseSchema1: unexpected retryable result on success")
+	}
+	if tag.Architecture != "amd64" {
+		t.Fatalf("Architecture: got %q, want %q", tag.Architecture, "amd64")
+	}
+	if tag.OS != "linux" {
+		t.Fatalf("OS: got %q, want %q", tag.OS, "linux")
+	}
+	if tag.Author != "someone" {
+		t.Fatalf("Author: got %q, want %q", tag.Author, "someone")
+	}
+	wantCreated, _ := time.Parse(time.RFC3339, "2020-01-02T03:04:05Z")
+	if !tag.Created.Equal(wantCreated) {
+		t.Fatalf("Created: got %v, want %v", tag.Created, wantCreated)
+	}
+	if tag.MediaType != "application/vnd.docker.distribution.manifest.v1+prettyjws" {
+		t.Fatalf("MediaType: got %q", tag.MediaType)
+	}
+}
+
+func TestParseSchema1InvalidJSON(t *testing.T) {
+	if _, _, err := parseSchema1(Tag{}, strings.NewReader("not json")); err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+}
+
+func TestParseSchema2(t *testing.T) {
+	body := strings.NewReader(`{
+		"config": {"digest": "", "size": 100},
+		"layers": [{"digest": "sha256:layer1", "size": 10}, {"digest": "sha256:layer2", "size": 20}]
+	}`)
+
+	tag, retryable, err := parseSchema2(nil, "http://localhost:5000", Tag{Repository: "library/alpine"}, body,
+		"application/vnd.docker.distribution.manifest.v2+json")
+	if err != nil {
+		t.Fatalf("parseSchema2: %v", err)
+	}
+	if retryable {
+		t.Fatal("parseSchema2: unexpected retryable result on success")
+	}
+	if tag.Size != 130 {
+		t.Fatalf("Size: got %d, want %d", tag.Size, 130)
+	}
+	if len(tag.Layers) != 2 {
+		t.Fatalf("Layers: got %d, want %d", len(tag.Layers), 2)
+	}
+	if tag.MediaType != "application/vnd.docker.distribution.manifest.v2+json" {
+		t.Fatalf("MediaType: got %q", tag.MediaType)
+	}
+}
+
+func TestParseSchema2InvalidJSON(t *testing.T) {
+	if _, _, err := parseSchema2(nil, "http://localhost:5000", Tag{}, strings.NewReader("not json"),
+		"application/vnd.docker.distribution.manifest.v2+json"); err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+}
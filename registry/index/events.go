@@ -0,0 +1,97 @@
+package index
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/distribution/notifications"
+)
+
+// broadcaster fans a persisted event out to any open /index/events
+// text/event-stream subscribers without blocking the Write path on slow
+// readers.
+type broadcaster struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{subs: make(map[chan Event]struct{})}
+}
+
+func (b *broadcaster) subscribe() chan Event {
+	ch := make(chan Event, 16)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *broadcaster) unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	delete(b.subs, ch)
+	b.mu.Unlock()
+	close(ch)
+}
+
+func (b *broadcaster) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			// Slow subscriber; drop rather than block the notification path.
+		}
+	}
+}
+
+func (self *IndexService) recordEvent(notification notifications.Event) {
+	event := Event{
+		Repository: notification.Target.Repository,
+		Tag:        self.parseTag(notification.Target.URL),
+		Digest:     string(notification.Target.Digest),
+		Action:     string(notification.Action),
+		Actor:      notification.Actor.Name,
+		Timestamp:  time.Now(),
+	}
+
+	if err := self.store.AppendEvent(event); err != nil {
+		logrus.Error("index: failed to append event: ", err)
+		return
+	}
+
+	self.broadcast.publish(event)
+}
+
+// Events returns the persisted event history matching args, newest last.
+func (self *IndexService) Events(args EventQueryArgs) ([]Event, error) {
+	return self.store.ListEvents(args)
+}
+
+// Subscribe registers a new text/event-stream listener. Callers must call
+// the returned cancel func once done reading.
+func (self *IndexService) Subscribe() (<-chan Event, func()) {
+	ch := self.broadcast.subscribe()
+	return ch, func() { self.broadcast.unsubscribe(ch) }
+}
+
+// sweepEvents prunes events older than the configured retention on a
+// fixed interval until the service is closed.
+func (self *IndexService) sweepEvents() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cutoff := time.Now().Add(-self.retention).Unix()
+			if err := self.store.PruneEvents(cutoff); err != nil {
+				logrus.Error("index: failed to prune events: ", err)
+			}
+		case <-self.stop:
+			return
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package index
 
 import (
-	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,33 +11,79 @@ import (
 	"github.com/docker/distribution/configuration"
 	"github.com/docker/distribution/manifest"
 	"github.com/docker/distribution/notifications"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 const (
 	defaultLimit = 20
 )
 
-type Repository struct {
-	Repository string `json:"repository"`
-	Tags       []Tag  `json:"tags"`
+// LayerInfo describes a single layer of an image manifest as recorded
+// against a tag.
+type LayerInfo struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
 }
 
-type Tag struct {
-	Repository  string    `json:"repository"`
-	Tag         string    `json:"tag"`
-	Digest      string    `json:"digest"`
-	Url         string    `json:"url"`
+// TagStatus is one CI/CD integration's view of a tag, keyed by context
+// (e.g. "ci/build", "security/scan") so several pipelines can report
+// independently against the same tag.
+type TagStatus struct {
+	Context     string    `json:"context"`
 	Status      string    `json:"status"`
 	Description string    `json:"description"`
 	TargetURL   string    `json:"target_url"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// Event is a persisted record of a notification the index has observed,
+// kept around for auditing via the /index/events endpoint.
+type Event struct {
+	ID         int64     `json:"id"`
+	Repository string    `json:"repository"`
+	Tag        string    `json:"tag"`
+	Digest     string    `json:"digest"`
+	Action     string    `json:"action"`
+	Actor      string    `json:"actor"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+type Repository struct {
+	Repository string `json:"repository"`
+	Tags       []Tag  `json:"tags"`
+}
+
+type Tag struct {
+	Repository         string      `json:"repository"`
+	Tag                string      `json:"tag"`
+	Digest             string      `json:"digest"`
+	Url                string      `json:"url"`
+	Status             string      `json:"status"`
+	Description        string      `json:"description"`
+	TargetURL          string      `json:"target_url"`
+	UpdatedAt          time.Time   `json:"updated_at"`
+	Size               int64       `json:"size,omitempty"`
+	Layers             []LayerInfo `json:"layers,omitempty"`
+	Architecture       string      `json:"architecture,omitempty"`
+	OS                 string      `json:"os,omitempty"`
+	Author             string      `json:"author,omitempty"`
+	Created            time.Time   `json:"created,omitempty"`
+	MediaType          string      `json:"media_type,omitempty"`
+	Platform           string      `json:"platform,omitempty"`
+	ManifestListDigest string      `json:"manifest_list_digest,omitempty"`
+	Statuses           []TagStatus `json:"statuses,omitempty"`
+
+	// listChild marks a manifest-list child enrichment job: its Tag field
+	// carries the parent list's pushed tag (for row matching), so fetching
+	// must be forced to the child's own Digest rather than falling back to
+	// Tag like a regular enrichment job would. See manifestReference.
+	listChild bool
+}
+
 type QueryArgs struct {
-	Keyword string
-	Skip    int
-	Limit   int
+	Keyword  string
+	Skip     int
+	Limit    int
+	Platform string
 }
 
 func (self *QueryArgs) prepare() {
@@ -50,94 +95,166 @@ func (self *QueryArgs) prepare() {
 	}
 }
 
+// EventQueryArgs filters the persisted event history served by
+// /index/events.
+type EventQueryArgs struct {
+	Since      time.Time
+	Until      time.Time
+	Repository string
+	Action     string
+}
+
+// IndexService keeps a searchable, queryable copy of the registry's
+// repository/tag state in sync with the notification stream and serves it
+// back out to the handlers package. Storage is delegated to a pluggable
+// Store so operators can run it against sqlite, postgres or mysql.
+//
+// Index settings (store driver/DSN, pool sizing, webhook secrets, event
+// retention) are passed in via Config rather than read off
+// configuration.Configuration: that type belongs to a different package,
+// so giving the index service its own settings doesn't require adding a
+// block to it. Callers parse their own "index:" section and pass it here
+// alongside the shared configuration.Configuration.
 type IndexService struct {
-	db *sql.DB
-}
-
-func New(configuration *configuration.Configuration) (*IndexService, error) {
-	var (
-		err   error
-		srv   = &IndexService{}
-		stmts [4]string
-	)
-	storageParams := configuration.Storage.Parameters()
-	dbPath := filepath.Join(fmt.Sprint(storageParams["rootdirectory"]), "registry.sqlite3")
-	os.MkdirAll(filepath.Dir(dbPath), 0755)
-	srv.db, err = sql.Open("sqlite3", dbPath)
+	store          Store
+	enricher       *enricher
+	broadcast      *broadcaster
+	retention      time.Duration
+	webhookSecrets map[string]string
+	stop           chan struct{}
+}
+
+func New(config *configuration.Configuration, indexConfig Config) (*IndexService, error) {
+	driver, dsn, err := storeParams(config, indexConfig)
 	if err != nil {
-		logrus.Error("Failed to open database: ", err)
 		return nil, err
 	}
 
-	stmts[0] = `create table if not exists tags(
-		id         integer primary key,
-		repository varchar(256),
-		digest     varchar(80),
-		url        varchar(256),
-		tag        varchar(256),
-		status     varchar(32),
-		description varchar(256),
-		target_url varchar(256),
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	)`
-	stmts[1] = `create unique index if not exists idx_name_tag on tags(repository, tag)`
-	stmts[2] = `create table if not exists repositories(
-		id         integer primary key,
-		repository varchar(256)
-	)`
-	stmts[3] = `create unique index if not exists idx_name on repositories(repository)`
-	for _, stmt := range stmts {
-		if _, err := srv.db.Exec(stmt); err != nil {
-			logrus.Error("Failed to prepare database: ", err)
-			return nil, err
-		}
+	store, err := newStore(driver, dsn, indexConfig.MaxOpenConns, indexConfig.MaxIdleConns)
+	if err != nil {
+		logrus.Error("Failed to open index store: ", err)
+		return nil, err
+	}
+
+	srv := &IndexService{
+		store:          store,
+		broadcast:      newBroadcaster(),
+		retention:      eventRetention(indexConfig),
+		webhookSecrets: webhookSecrets(indexConfig),
+		stop:           make(chan struct{}),
 	}
+	srv.enricher = newEnricher(srv, config, indexConfig)
+
+	go srv.sweepEvents()
 
 	return srv, nil
 }
 
+// storeParams extracts the driver/dsn for the index store out of
+// indexConfig, falling back to the legacy sqlite file that lived next to
+// the blob storage root directory so existing deployments keep working
+// unconfigured.
+func storeParams(config *configuration.Configuration, indexConfig Config) (driver, dsn string, err error) {
+	driver = indexConfig.Driver
+	if driver == "" {
+		driver = "sqlite3"
+	}
+
+	if indexConfig.DSN != "" {
+		return driver, indexConfig.DSN, nil
+	}
+
+	dbPath := filepath.Join(fmt.Sprint(config.Storage.Parameters()["rootdirectory"]), "registry.sqlite3")
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return "", "", err
+	}
+	return "sqlite3", dbPath, nil
+}
+
+// webhookSecrets builds the per-integration-context webhook secret lookup:
+// WebhookSecret is the default used for contexts with no override, and
+// WebhookSecrets lets a specific CI integration (keyed by the same
+// "context" it PATCHes tag status under, e.g. "ci/build") sign with its
+// own key instead of sharing the registry-wide one.
+func webhookSecrets(indexConfig Config) map[string]string {
+	secrets := map[string]string{"default": indexConfig.WebhookSecret}
+	for context, secret := range indexConfig.WebhookSecrets {
+		secrets[context] = secret
+	}
+	return secrets
+}
+
+func eventRetention(indexConfig Config) time.Duration {
+	if indexConfig.EventRetention > 0 {
+		return indexConfig.EventRetention
+	}
+	return 30 * 24 * time.Hour
+}
+
 func (self *IndexService) Write(events ...notifications.Event) error {
 	for _, event := range events {
-		if event.Target.MediaType == manifest.ManifestMediaType {
-			if event.Action == notifications.EventActionDelete {
-				if err := self.delete(event); err != nil {
-					return err
-				}
-			} else if event.Action == notifications.EventActionPush {
-				if err := self.add(event); err != nil {
-					return err
-				}
+		if !isIndexableMediaType(event.Target.MediaType) {
+			continue
+		}
+
+		if event.Action == notifications.EventActionDelete {
+			if err := self.delete(event); err != nil {
+				return err
+			}
+		} else if event.Action == notifications.EventActionPush {
+			if err := self.add(event); err != nil {
+				return err
 			}
 		}
+
+		self.recordEvent(event)
 	}
 	return nil
 }
 
 func (self *IndexService) delete(event notifications.Event) error {
+	if isManifestListMediaType(event.Target.MediaType) {
+		if err := self.store.DeleteManifestList(event.Target.Repository, string(event.Target.Digest)); err != nil {
+			return err
+		}
+		return self.store.PruneRepositories()
+	}
+
 	tag := self.parseTag(event.Target.URL)
-	query := "delete from tags where repository=? and tag=?"
-	_, err := self.db.Exec(query, event.Target.Repository, tag)
-	if err == nil {
-		_, err = self.db.Exec("delete from repositories where repository not in (select distinct repository from tags)")
+	if err := self.store.DeleteTag(event.Target.Repository, tag); err != nil {
+		return err
 	}
-	return err
+	return self.store.PruneRepositories()
 }
 
 func (self *IndexService) add(event notifications.Event) error {
 	target := event.Target
-	query := "replace into repositories(repository) values(?)"
 
-	if _, err := self.db.Exec(query, target.Repository); err != nil {
-		logrus.Error("sqlite insert: ", err)
+	if err := self.store.AddRepository(target.Repository); err != nil {
+		logrus.Error("index insert: ", err)
 		return err
 	}
 
-	query = "replace into tags(repository, tag, digest, url, updated_at, status, description, target_url) values(?,?,?,?,?,'unset','','')"
-	tag := self.parseTag(event.Target.URL)
-	if _, err := self.db.Exec(query, target.Repository, tag, string(target.Digest), target.URL, time.Now()); err != nil {
-		logrus.Error("sqlite insert: ", err)
+	tag := self.parseTag(target.URL)
+
+	if isManifestListMediaType(target.MediaType) {
+		return self.addManifestList(event, tag)
+	}
+
+	record := Tag{
+		Repository: target.Repository,
+		Tag:        tag,
+		Digest:     string(target.Digest),
+		Url:        target.URL,
+		Status:     "unset",
+		MediaType:  target.MediaType,
+	}
+	if err := self.store.AddTag(record); err != nil {
+		logrus.Error("index insert: ", err)
 		return err
 	}
+
+	self.enricher.enqueue(record)
 	return nil
 }
 
@@ -151,69 +268,57 @@ func (self *IndexService) parseTag(url string) string {
 
 func (self *IndexService) Close() error {
 	logrus.Debug("index service close")
-	self.db.Close()
-	return nil
+	close(self.stop)
+	self.enricher.stop()
+	return self.store.Close()
 }
 
 func (self *IndexService) Sink() notifications.Sink {
 	return self
 }
 
+// Ping is used by the /debug/health machinery to surface the index's own
+// availability alongside the other registry dependencies.
+func (self *IndexService) Ping() error {
+	return self.store.Ping()
+}
+
 func (self *IndexService) GetPage(args QueryArgs) ([]Repository, error) {
 	args.prepare()
-	query := "select repository from repositories "
-	if len(args.Keyword) > 0 {
-		query += " where repository like ? "
-	}
-	query += " limit ? offset ?"
-
-	stmt, err := self.db.Prepare(query)
-	if err != nil {
-		logrus.Error("select prepare: ", err)
-		return nil, err
-	}
-	defer stmt.Close()
+	return self.store.ListRepositories(args)
+}
 
-	var rows *sql.Rows
+func (self *IndexService) SetTagStatus(repo, tag, status, description, targetURL string) error {
+	return self.SetTagStatusContext(repo, tag, "default", status, description, targetURL)
+}
 
-	if len(args.Keyword) > 0 {
-		rows, err = stmt.Query("%"+args.Keyword+"%", args.Limit, args.Skip)
-	} else {
-		rows, err = stmt.Query(args.Limit, args.Skip)
-	}
+func (self *IndexService) SetTagStatusContext(repo, tag, context, status, description, targetURL string) error {
+	return self.store.SetTagStatus(repo, tag, context, status, description, targetURL)
+}
 
-	if err != nil {
-		logrus.Error("sqlite query: ", err)
-		return nil, err
-	}
+func (self *IndexService) TagStatuses(repo, tag string) ([]TagStatus, error) {
+	return self.store.ListTagStatuses(repo, tag)
+}
 
-	records := []Repository{}
-	for rows.Next() {
-		record := Repository{Tags: []Tag{}}
-		err = rows.Scan(&record.Repository)
-		if err == nil {
-			var tags *sql.Rows
-			tags, err = self.db.Query("select repository, tag, digest, url, status, description, target_url, updated_at from tags where repository = ?", record.Repository)
-			if err == nil {
-				for tags.Next() {
-					tag := Tag{}
-					err = tags.Scan(&tag.Repository, &tag.Tag, &tag.Digest, &tag.Url, &tag.Status, &tag.Description, &tag.TargetURL, &tag.UpdatedAt)
-					if err == nil {
-						record.Tags = append(record.Tags, tag)
-					}
-				}
-			}
-		}
-		if err != nil {
-			logrus.Error("failed to scan rows: ", err)
-			continue
-		}
-		records = append(records, record)
+func isIndexableMediaType(mediaType string) bool {
+	switch mediaType {
+	case manifest.ManifestMediaType,
+		"application/vnd.docker.distribution.manifest.v2+json",
+		"application/vnd.docker.distribution.manifest.list.v2+json",
+		"application/vnd.oci.image.manifest.v1+json",
+		"application/vnd.oci.image.index.v1+json":
+		return true
+	default:
+		return false
 	}
-	return records, nil
 }
 
-func (self *IndexService) SetTagStatus(repo, tag, status, description, target_url string) error {
-	_, err := self.db.Exec("update tags set status=?, description=?, target_url=? where repository=? and tag=?", status, description, target_url, repo, tag)
-	return err
+func isManifestListMediaType(mediaType string) bool {
+	switch mediaType {
+	case "application/vnd.docker.distribution.manifest.list.v2+json",
+		"application/vnd.oci.image.index.v1+json":
+		return true
+	default:
+		return false
+	}
 }
@@ -0,0 +1,154 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/distribution/notifications"
+)
+
+// manifestListEntry is one child reference of a schema2 manifest list or
+// OCI image index.
+type manifestListEntry struct {
+	Digest    string `json:"digest"`
+	MediaType string `json:"mediaType"`
+	Platform  struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+		Variant      string `json:"variant"`
+	} `json:"platform"`
+}
+
+type manifestList struct {
+	Manifests []manifestListEntry `json:"manifests"`
+}
+
+// manifestListJob is the work item queued for a pushed manifest-list/OCI
+// index: resolve each child manifest and insert one tag row per platform.
+type manifestListJob struct {
+	repository string
+	tag        string
+	digest     string
+	url        string
+	mediaType  string
+}
+
+// addManifestList writes a placeholder row for the list itself - same as
+// the single-manifest path in index.go:add - before queueing expansion
+// onto the enricher's worker pool, so the pushed tag is visible in the
+// index immediately instead of only appearing once (and if) the worker
+// pool has room to expand it. Expansion itself stays off the notification
+// path, just like single-arch enrichment does.
+func (self *IndexService) addManifestList(event notifications.Event, tag string) error {
+	target := event.Target
+
+	placeholder := Tag{
+		Repository:         target.Repository,
+		Tag:                tag,
+		Digest:             string(target.Digest),
+		Url:                target.URL,
+		Status:             "unset",
+		MediaType:          target.MediaType,
+		ManifestListDigest: string(target.Digest),
+	}
+	if err := self.store.AddTag(placeholder); err != nil {
+		logrus.Error("index insert: ", err)
+		return err
+	}
+
+	self.enricher.enqueueList(manifestListJob{
+		repository: target.Repository,
+		tag:        tag,
+		digest:     string(target.Digest),
+		url:        target.URL,
+		mediaType:  target.MediaType,
+	})
+	return nil
+}
+
+// processList resolves a manifest-list/OCI-index job into one tag row per
+// child platform, grouped by manifest_list_digest so DeleteManifestList
+// can cascade the delete.
+func (e *enricher) processList(job manifestListJob) {
+	list, err := e.fetchManifestListWithRetry(job)
+	if err != nil {
+		logrus.Error("index: failed to fetch manifest list for ", job.repository, ":", job.tag, ": ", err)
+		return
+	}
+
+	for _, child := range list.Manifests {
+		platform := child.Platform.OS + "/" + child.Platform.Architecture
+		if child.Platform.Variant != "" {
+			platform += "/" + child.Platform.Variant
+		}
+
+		record := Tag{
+			Repository:         job.repository,
+			Tag:                job.tag,
+			Digest:             child.Digest,
+			Url:                job.url,
+			Status:             "unset",
+			MediaType:          child.MediaType,
+			Platform:           platform,
+			ManifestListDigest: job.digest,
+			listChild:          true,
+		}
+		if err := e.service.store.AddManifestListChild(record); err != nil {
+			logrus.Error("index: failed to insert manifest list child: ", err)
+			continue
+		}
+		e.enqueue(record)
+	}
+}
+
+// fetchManifestListWithRetry retries fetchManifestList on 5xx/429 with the
+// same backoff schedule as single-manifest enrichment in enrich.go.
+func (e *enricher) fetchManifestListWithRetry(job manifestListJob) (manifestList, error) {
+	var lastErr error
+	for attempt := 0; attempt < e.maxRetry; attempt++ {
+		if attempt > 0 {
+			time.Sleep(e.backoff(attempt))
+		}
+
+		list, retryable, err := e.fetchManifestList(job)
+		if err == nil {
+			return list, nil
+		}
+		lastErr = err
+		if !retryable {
+			break
+		}
+	}
+	return manifestList{}, lastErr
+}
+
+func (e *enricher) fetchManifestList(job manifestListJob) (manifestList, bool, error) {
+	url := fmt.Sprintf("%s/v2/%s/manifests/%s", e.baseURL, job.repository, job.digest)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return manifestList{}, false, err
+	}
+	req.Header.Set("Accept", job.mediaType)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return manifestList{}, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return manifestList{}, true, fmt.Errorf("index: manifest list fetch for %s:%s returned %d", job.repository, job.tag, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return manifestList{}, false, fmt.Errorf("index: manifest list fetch for %s:%s returned %d", job.repository, job.tag, resp.StatusCode)
+	}
+
+	var list manifestList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return manifestList{}, false, err
+	}
+	return list, true, nil
+}
@@ -0,0 +1,69 @@
+package index
+
+import "github.com/Sirupsen/logrus"
+
+// Migration is one forward-only, numbered schema change. Versions must be
+// contiguous starting at 1 and are applied in order; once a migration has
+// shipped, its Statements must never be edited - only new migrations with
+// higher Version values may be appended. This is deliberately a small,
+// dependency-free stand-in for a goose/golang-migrate runner: the three
+// backends disagree enough on DDL (autoincrement syntax, datetime
+// defaults, sqlite-only FTS5) that per-driver migration files beat a
+// single portable dialect, but there's no need for a full migration
+// library just to track which of a handful of steps have run.
+type Migration struct {
+	Version     int
+	Description string
+	Statements  []string
+}
+
+// createSchemaMigrations is portable across all three backends: it takes
+// no autoincrement (callers always supply the version explicitly) and
+// every dialect accepts a bare "timestamp" column type.
+const createSchemaMigrations = `create table if not exists schema_migrations(
+	version    integer primary key,
+	applied_at timestamp default current_timestamp
+)`
+
+// runMigrations applies every migration in set with a Version greater than
+// the highest one already recorded in schema_migrations, in order, each
+// inside its own transaction so a failure partway through a step doesn't
+// mark it as applied.
+func (s *sqlStore) runMigrations(set []Migration) error {
+	if _, err := s.db.Exec(createSchemaMigrations); err != nil {
+		return err
+	}
+
+	var current int
+	if err := s.db.QueryRow("select coalesce(max(version), 0) from schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+
+	for _, m := range set {
+		if m.Version <= current {
+			continue
+		}
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		for _, stmt := range m.Statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if _, err := tx.Exec(s.q("insert into schema_migrations(version) values(?)"), m.Version); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		logrus.Debug("index: applied migration ", m.Version, " (", m.Description, ")")
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package index
+
+var mysqlMigrations = []Migration{
+	{
+		Version:     1,
+		Description: "repositories and tags",
+		Statements: []string{
+			`create table repositories(
+				id         integer primary key auto_increment,
+				repository varchar(256),
+				unique key idx_name (repository)
+			)`,
+			`create table tags(
+				id                   integer primary key auto_increment,
+				repository           varchar(256),
+				tag                  varchar(256),
+				digest               varchar(80),
+				url                  varchar(256),
+				status               varchar(32),
+				description          varchar(256),
+				target_url           varchar(256),
+				updated_at           datetime default current_timestamp,
+				size                 bigint,
+				architecture         varchar(32),
+				os                   varchar(32),
+				author               varchar(256),
+				created              datetime null,
+				media_type           varchar(128),
+				platform             varchar(64),
+				manifest_list_digest varchar(80),
+				unique key idx_name_tag (repository, tag, platform)
+			)`,
+			`create table tag_layers(
+				id       integer primary key auto_increment,
+				tag_id   integer,
+				position integer,
+				digest   varchar(80),
+				size     bigint,
+				foreign key (tag_id) references tags(id) on delete cascade
+			)`,
+		},
+	},
+	{
+		Version:     2,
+		Description: "per-integration tag statuses",
+		Statements: []string{
+			`create table tag_statuses(
+				id          integer primary key auto_increment,
+				repository  varchar(256),
+				tag         varchar(256),
+				context     varchar(64),
+				status      varchar(32),
+				description varchar(256),
+				target_url  varchar(256),
+				updated_at  datetime default current_timestamp,
+				unique key idx_status_context (repository, tag, context)
+			)`,
+		},
+	},
+	{
+		Version:     3,
+		Description: "event history",
+		Statements: []string{
+			`create table events(
+				id         integer primary key auto_increment,
+				repository varchar(256),
+				tag        varchar(256),
+				digest     varchar(80),
+				action     varchar(32),
+				actor      varchar(256),
+				timestamp  datetime default current_timestamp,
+				key idx_events_repository (repository),
+				key idx_events_timestamp (timestamp)
+			)`,
+		},
+	},
+}
@@ -0,0 +1,75 @@
+package index
+
+var postgresMigrations = []Migration{
+	{
+		Version:     1,
+		Description: "repositories and tags",
+		Statements: []string{
+			`create table repositories(
+				id         serial primary key,
+				repository varchar(256) unique
+			)`,
+			`create table tags(
+				id                   serial primary key,
+				repository           varchar(256),
+				tag                  varchar(256),
+				digest               varchar(80),
+				url                  varchar(256),
+				status               varchar(32),
+				description          varchar(256),
+				target_url           varchar(256),
+				updated_at           timestamptz default now(),
+				size                 bigint,
+				architecture         varchar(32),
+				os                   varchar(32),
+				author               varchar(256),
+				created              timestamptz,
+				media_type           varchar(128),
+				platform             varchar(64),
+				manifest_list_digest varchar(80),
+				unique(repository, tag, platform)
+			)`,
+			`create table tag_layers(
+				id       serial primary key,
+				tag_id   integer references tags(id) on delete cascade,
+				position integer,
+				digest   varchar(80),
+				size     bigint
+			)`,
+		},
+	},
+	{
+		Version:     2,
+		Description: "per-integration tag statuses",
+		Statements: []string{
+			`create table tag_statuses(
+				id          serial primary key,
+				repository  varchar(256),
+				tag         varchar(256),
+				context     varchar(64),
+				status      varchar(32),
+				description varchar(256),
+				target_url  varchar(256),
+				updated_at  timestamptz default now(),
+				unique(repository, tag, context)
+			)`,
+		},
+	},
+	{
+		Version:     3,
+		Description: "event history",
+		Statements: []string{
+			`create table events(
+				id         serial primary key,
+				repository varchar(256),
+				tag        varchar(256),
+				digest     varchar(80),
+				action     varchar(32),
+				actor      varchar(256),
+				timestamp  timestamptz default now()
+			)`,
+			`create index idx_events_repository on events(repository)`,
+			`create index idx_events_timestamp on events(timestamp)`,
+		},
+	},
+}
@@ -0,0 +1,89 @@
+package index
+
+var sqliteMigrations = []Migration{
+	{
+		Version:     1,
+		Description: "repositories and tags",
+		Statements: []string{
+			`create table repositories(
+				id         integer primary key,
+				repository varchar(256)
+			)`,
+			`create unique index idx_name on repositories(repository)`,
+			`create table tags(
+				id                   integer primary key,
+				repository           varchar(256),
+				tag                  varchar(256),
+				digest               varchar(80),
+				url                  varchar(256),
+				status               varchar(32),
+				description          varchar(256),
+				target_url           varchar(256),
+				updated_at           DATETIME DEFAULT CURRENT_TIMESTAMP,
+				size                 integer,
+				architecture         varchar(32),
+				os                   varchar(32),
+				author               varchar(256),
+				created              DATETIME,
+				media_type           varchar(128),
+				platform             varchar(64),
+				manifest_list_digest varchar(80)
+			)`,
+			`create unique index idx_name_tag_platform on tags(repository, tag, platform)`,
+			`create table tag_layers(
+				id        integer primary key,
+				tag_id    integer references tags(id) on delete cascade,
+				position  integer,
+				digest    varchar(80),
+				size      integer
+			)`,
+		},
+	},
+	{
+		Version:     2,
+		Description: "per-integration tag statuses",
+		Statements: []string{
+			`create table tag_statuses(
+				id          integer primary key,
+				repository  varchar(256),
+				tag         varchar(256),
+				context     varchar(64),
+				status      varchar(32),
+				description varchar(256),
+				target_url  varchar(256),
+				updated_at  DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`create unique index idx_status_context on tag_statuses(repository, tag, context)`,
+		},
+	},
+	{
+		Version:     3,
+		Description: "event history",
+		Statements: []string{
+			`create table events(
+				id         integer primary key,
+				repository varchar(256),
+				tag        varchar(256),
+				digest     varchar(80),
+				action     varchar(32),
+				actor      varchar(256),
+				timestamp  DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`create index idx_events_repository on events(repository)`,
+			`create index idx_events_timestamp on events(timestamp)`,
+		},
+	},
+	{
+		Version:     4,
+		Description: "FTS5 repository search",
+		Statements: []string{
+			`create virtual table repositories_fts using fts5(repository, description, content='repositories', content_rowid='id')`,
+			`create trigger repositories_ai after insert on repositories begin
+				insert into repositories_fts(rowid, repository, description) values (new.id, new.repository, '');
+			end`,
+			`create trigger repositories_ad after delete on repositories begin
+				insert into repositories_fts(repositories_fts, rowid, repository, description) values('delete', old.id, old.repository, '');
+			end`,
+		},
+	},
+}
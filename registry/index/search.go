@@ -0,0 +1,102 @@
+package index
+
+import "strings"
+
+// SearchResult is one hit of a /v1/search query, shaped to match the
+// response moby/docker search clients already expect.
+type SearchResult struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	IsOfficial  bool   `json:"is_official"`
+	IsAutomated bool   `json:"is_automated"`
+	StarCount   int    `json:"star_count"`
+}
+
+// Search ranks repositories matching term and returns a page of results
+// plus the total result count so callers can compute num_pages.
+func (self *IndexService) Search(term string, page, pageSize int) ([]SearchResult, int, error) {
+	if pageSize < 1 {
+		pageSize = defaultLimit
+	}
+	if page < 1 {
+		page = 1
+	}
+	skip := (page - 1) * pageSize
+	return self.store.Search(term, skip, pageSize)
+}
+
+func (s *sqlStore) Search(term string, skip, limit int) ([]SearchResult, int, error) {
+	if s.dialect.ftsEnabled {
+		return s.searchFTS(term, skip, limit)
+	}
+	return s.searchLike(term, skip, limit)
+}
+
+// searchFTS uses the repositories_fts virtual table (sqlite FTS5) for
+// relevance-ordered, prefix/word aware matching instead of a LIKE scan.
+func (s *sqlStore) searchFTS(term string, skip, limit int) ([]SearchResult, int, error) {
+	if term == "" {
+		return s.searchLike(term, skip, limit)
+	}
+
+	match := ftsMatchQuery(term)
+
+	var total int
+	countRow := s.db.QueryRow("select count(*) from repositories_fts where repositories_fts match ?", match)
+	if err := countRow.Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(
+		`select r.repository from repositories_fts f join repositories r on r.id = f.rowid
+			where repositories_fts match ? order by f.rank limit ? offset ?`,
+		match, limit, skip)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			continue
+		}
+		results = append(results, SearchResult{Name: name})
+	}
+	return results, total, nil
+}
+
+// ftsMatchQuery turns a raw search term into an FTS5 phrase-prefix query.
+// Quoting the whole term as a phrase stops characters FTS5's query syntax
+// treats specially (-, :, (, ), ", etc. - all of which show up in ordinary
+// image names like "my-image") from being parsed as operators; doubling
+// embedded quotes escapes them, matching FTS5's own quoting rule.
+func ftsMatchQuery(term string) string {
+	return `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+}
+
+func (s *sqlStore) searchLike(term string, skip, limit int) ([]SearchResult, int, error) {
+	like := "%" + term + "%"
+
+	var total int
+	if err := s.db.QueryRow(s.q("select count(*) from repositories where repository like ?"), like).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(s.q("select repository from repositories where repository like ? limit ? offset ?"), like, limit, skip)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			continue
+		}
+		results = append(results, SearchResult{Name: name})
+	}
+	return results, total, nil
+}
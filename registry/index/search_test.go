@@ -0,0 +1,60 @@
+package index
+
+import "testing"
+
+func TestSearchFTSReturnsRepositoryName(t *testing.T) {
+	store, err := newStore("sqlite3", ":memory:", 0, 0)
+	if err != nil {
+		t.Fatalf("newStore: %v", err)
+	}
+	defer store.Close()
+
+	s := store.(*sqlStore)
+	if !s.dialect.ftsEnabled {
+		t.Fatal("expected sqlite3 store to have FTS5 enabled")
+	}
+
+	if err := s.AddRepository("library/alpine"); err != nil {
+		t.Fatalf("AddRepository: %v", err)
+	}
+
+	results, total, err := s.Search("alpine", 0, 20)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if total == 0 || len(results) == 0 {
+		t.Fatalf("expected a non-empty search result, got total=%d results=%v", total, results)
+	}
+	if results[0].Name != "library/alpine" {
+		t.Fatalf("expected repository name %q, got %q", "library/alpine", results[0].Name)
+	}
+}
+
+func TestSearchFTSHyphenatedTermDoesNotError(t *testing.T) {
+	store, err := newStore("sqlite3", ":memory:", 0, 0)
+	if err != nil {
+		t.Fatalf("newStore: %v", err)
+	}
+	defer store.Close()
+
+	s := store.(*sqlStore)
+	if err := s.AddRepository("library/my-image"); err != nil {
+		t.Fatalf("AddRepository: %v", err)
+	}
+
+	results, total, err := s.Search("my-image", 0, 20)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if total == 0 || len(results) == 0 {
+		t.Fatalf("expected a non-empty search result, got total=%d results=%v", total, results)
+	}
+}
+
+func TestFTSMatchQueryQuotesSpecialCharacters(t *testing.T) {
+	got := ftsMatchQuery(`my-image:"latest"`)
+	want := `"my-image:""latest"""*`
+	if got != want {
+		t.Fatalf("ftsMatchQuery: got %q, want %q", got, want)
+	}
+}
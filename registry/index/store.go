@@ -0,0 +1,224 @@
+package index
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Store abstracts the persistence backend for the index so it can run
+// against sqlite for a single-host install or postgres/mysql for an HA
+// registry deployment. Implementations are selected by driver name in
+// newStore and run the versioned migrations defined per-driver in
+// migrations_sqlite.go/migrations_postgres.go/migrations_mysql.go.
+type Store interface {
+	AddRepository(repository string) error
+	AddTag(tag Tag) error
+	DeleteTag(repository, tag string) error
+	PruneRepositories() error
+	ListRepositories(args QueryArgs) ([]Repository, error)
+	SetTagStatus(repository, tag, context, status, description, targetURL string) error
+	ListTagStatuses(repository, tag string) ([]TagStatus, error)
+	UpdateEnrichment(tag Tag) error
+	AppendEvent(event Event) error
+	ListEvents(args EventQueryArgs) ([]Event, error)
+	PruneEvents(before int64) error
+	AddManifestListChild(tag Tag) error
+	DeleteManifestList(repository, listDigest string) error
+	Search(term string, skip, limit int) ([]SearchResult, int, error)
+	Ping() error
+	Close() error
+}
+
+// newStore opens a Store for the given driver/dsn and runs its migrations.
+// maxOpenConns/maxIdleConns override the dialect's defaults when positive,
+// so index.max_open_conns/index.max_idle_conns can tune pool sizing per
+// deployment instead of being fixed per-driver.
+func newStore(driver, dsn string, maxOpenConns, maxIdleConns int) (Store, error) {
+	sqlDriver := driver
+	switch driver {
+	case "postgres", "postgresql":
+		sqlDriver = "postgres"
+	case "mysql":
+		sqlDriver = "mysql"
+	case "sqlite3", "sqlite":
+		sqlDriver = "sqlite3"
+	default:
+		return nil, fmt.Errorf("index: unsupported store driver %q", driver)
+	}
+
+	db, err := sql.Open(sqlDriver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	if sqlDriver == "sqlite3" {
+		// tag_layers declares "on delete cascade" against tags, which
+		// sqlite only honors once foreign key enforcement is turned on
+		// per-connection.
+		if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+			return nil, err
+		}
+	}
+
+	dialect := dialectFor(sqlDriver)
+	if maxOpenConns > 0 {
+		dialect.maxOpenConns = maxOpenConns
+	}
+	if maxIdleConns > 0 {
+		dialect.maxIdleConns = maxIdleConns
+	}
+	db.SetMaxOpenConns(dialect.maxOpenConns)
+	db.SetMaxIdleConns(dialect.maxIdleConns)
+
+	s := &sqlStore{db: db, dialect: dialect}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// dialect carries the handful of things that actually differ between the
+// three supported backends: how migrations and upserts are phrased, the
+// placeholder syntax, whether FTS5 search is available, and how many
+// connections are sensible defaults. Everything else is plain SQL.
+type dialect struct {
+	name             string
+	migrations       []Migration
+	maxOpenConns     int
+	maxIdleConns     int
+	rebind           func(query string) string
+	ftsEnabled       bool
+	upsertRepository string
+	upsertTag        string
+}
+
+func dialectFor(name string) dialect {
+	switch name {
+	case "postgres":
+		return dialect{
+			name:             "postgres",
+			migrations:       postgresMigrations,
+			maxOpenConns:     25,
+			maxIdleConns:     5,
+			rebind:           rebindDollar,
+			upsertRepository: `insert into repositories(repository) values(?) on conflict(repository) do nothing`,
+			upsertTag: `insert into tags(repository, tag, platform, digest, url, updated_at, status, description, target_url, media_type, manifest_list_digest)
+				values(?,?,?,?,?,?,'unset','','',?,?)
+				on conflict(repository, tag, platform) do update set digest=excluded.digest, url=excluded.url, updated_at=excluded.updated_at, media_type=excluded.media_type, manifest_list_digest=excluded.manifest_list_digest`,
+		}
+	case "mysql":
+		return dialect{
+			name:             "mysql",
+			migrations:       mysqlMigrations,
+			maxOpenConns:     25,
+			maxIdleConns:     5,
+			rebind:           rebindNoop,
+			upsertRepository: `insert into repositories(repository) values(?) on duplicate key update repository=values(repository)`,
+			upsertTag: `insert into tags(repository, tag, platform, digest, url, updated_at, status, description, target_url, media_type, manifest_list_digest)
+				values(?,?,?,?,?,?,'unset','','',?,?)
+				on duplicate key update digest=values(digest), url=values(url), updated_at=values(updated_at), media_type=values(media_type), manifest_list_digest=values(manifest_list_digest)`,
+		}
+	default:
+		return dialect{
+			name:             "sqlite3",
+			migrations:       sqliteMigrations,
+			maxOpenConns:     1,
+			maxIdleConns:     1,
+			rebind:           rebindNoop,
+			ftsEnabled:       true,
+			upsertRepository: `replace into repositories(repository) values(?)`,
+			upsertTag: `replace into tags(repository, tag, platform, digest, url, updated_at, status, description, target_url, media_type, manifest_list_digest)
+				values(?,?,?,?,?,?,'unset','','',?,?)`,
+		}
+	}
+}
+
+// rebindNoop leaves "?" placeholders alone, which both sqlite3 and the
+// mysql driver accept natively.
+func rebindNoop(query string) string { return query }
+
+// rebindDollar turns "?" placeholders into postgres' "$1, $2, ..." form.
+func rebindDollar(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func (s *sqlStore) migrate() error {
+	if err := s.runMigrations(s.dialect.migrations); err != nil {
+		logrus.Error("index: failed to run migrations: ", err)
+		return err
+	}
+
+	if s.dialect.ftsEnabled {
+		if err := s.fixContentlessFTS(); err != nil {
+			logrus.Error("index: failed to migrate repositories_fts: ", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// fixContentlessFTS repairs a repositories_fts table created by an earlier
+// version of this migration with content='', which only builds the
+// inverted index and discards the indexed text: every column read back
+// from such a table is NULL. Detect that case via its stored DDL and
+// recreate it as an external-content table backed by repositories,
+// backfilling from the rows that already exist.
+func (s *sqlStore) fixContentlessFTS() error {
+	var createSQL string
+	row := s.db.QueryRow("select sql from sqlite_master where type='table' and name='repositories_fts'")
+	if err := row.Scan(&createSQL); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	if !strings.Contains(createSQL, "content=''") {
+		return nil
+	}
+
+	if _, err := s.db.Exec("drop table repositories_fts"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`create virtual table repositories_fts using fts5(repository, description, content='repositories', content_rowid='id')`); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`insert into repositories_fts(rowid, repository, description) select id, repository, '' from repositories`)
+	return err
+}
+
+func (s *sqlStore) q(query string) string {
+	return s.dialect.rebind(query)
+}
+
+func (s *sqlStore) Ping() error {
+	return s.db.Ping()
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,308 @@
+package index
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func (s *sqlStore) AddRepository(repository string) error {
+	_, err := s.db.Exec(s.q(s.dialect.upsertRepository), repository)
+	if err != nil {
+		logrus.Error("index: insert repository: ", err)
+	}
+	return err
+}
+
+func (s *sqlStore) AddTag(tag Tag) error {
+	_, err := s.db.Exec(s.q(s.dialect.upsertTag),
+		tag.Repository, tag.Tag, tag.Platform, tag.Digest, tag.Url, time.Now(), tag.MediaType, tag.ManifestListDigest)
+	if err != nil {
+		logrus.Error("index: insert tag: ", err)
+	}
+	return err
+}
+
+func (s *sqlStore) DeleteTag(repository, tag string) error {
+	_, err := s.db.Exec(s.q("delete from tags where repository=? and tag=?"), repository, tag)
+	return err
+}
+
+func (s *sqlStore) PruneRepositories() error {
+	_, err := s.db.Exec(s.q("delete from repositories where repository not in (select distinct repository from tags)"))
+	return err
+}
+
+func (s *sqlStore) ListRepositories(args QueryArgs) ([]Repository, error) {
+	query := "select repository from repositories"
+	var filterArgs []interface{}
+	if len(args.Keyword) > 0 {
+		query += " where repository like ?"
+		filterArgs = append(filterArgs, "%"+args.Keyword+"%")
+	}
+	query += " limit ? offset ?"
+	filterArgs = append(filterArgs, args.Limit, args.Skip)
+
+	rows, err := s.db.Query(s.q(query), filterArgs...)
+	if err != nil {
+		logrus.Error("index: list repositories: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []Repository{}
+	for rows.Next() {
+		record := Repository{Tags: []Tag{}}
+		if err := rows.Scan(&record.Repository); err != nil {
+			logrus.Error("index: failed to scan repository: ", err)
+			continue
+		}
+
+		tags, err := s.listTags(record.Repository, args.Platform)
+		if err != nil {
+			logrus.Error("index: failed to list tags: ", err)
+			continue
+		}
+		record.Tags = tags
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (s *sqlStore) listTags(repository, platform string) ([]Tag, error) {
+	// The platform-less placeholder row written for a pushed manifest list
+	// (manifest_list_digest set, platform='') is only meant to hold the
+	// pushed tag's place until the worker pool expands it into per-platform
+	// child rows; once at least one child exists, the placeholder is
+	// superseded and would otherwise show up as a permanent extra,
+	// empty-metadata duplicate of the same tag.
+	query := `select t.id, t.repository, t.tag, t.digest, t.url, t.status, t.description, t.target_url, t.updated_at,
+		t.size, t.architecture, t.os, t.author, t.created, t.media_type, t.platform, t.manifest_list_digest
+		from tags t where t.repository = ?
+		and not (
+			t.platform = '' and t.manifest_list_digest <> ''
+			and exists (select 1 from tags c where c.manifest_list_digest = t.manifest_list_digest and c.platform <> '')
+		)`
+	queryArgs := []interface{}{repository}
+	if platform != "" {
+		query += " and t.platform = ?"
+		queryArgs = append(queryArgs, platform)
+	}
+
+	rows, err := s.db.Query(s.q(query), queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var (
+			tag     Tag
+			id      int64
+			size    sql.NullInt64
+			arch    sql.NullString
+			os      sql.NullString
+			author  sql.NullString
+			created sql.NullTime
+			media   sql.NullString
+			plat    sql.NullString
+			listDig sql.NullString
+		)
+		err := rows.Scan(&id, &tag.Repository, &tag.Tag, &tag.Digest, &tag.Url, &tag.Status, &tag.Description,
+			&tag.TargetURL, &tag.UpdatedAt, &size, &arch, &os, &author, &created, &media, &plat, &listDig)
+		if err != nil {
+			logrus.Error("index: failed to scan tag: ", err)
+			continue
+		}
+		tag.Size = size.Int64
+		tag.Architecture = arch.String
+		tag.OS = os.String
+		tag.Author = author.String
+		if created.Valid {
+			tag.Created = created.Time
+		}
+		tag.MediaType = media.String
+		tag.Platform = plat.String
+		tag.ManifestListDigest = listDig.String
+
+		tag.Layers, err = s.listLayers(id)
+		if err != nil {
+			logrus.Error("index: failed to list layers: ", err)
+		}
+		tag.Statuses, err = s.ListTagStatuses(tag.Repository, tag.Tag)
+		if err != nil {
+			logrus.Error("index: failed to list tag statuses: ", err)
+		}
+
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func (s *sqlStore) listLayers(tagID int64) ([]LayerInfo, error) {
+	rows, err := s.db.Query(s.q("select digest, size from tag_layers where tag_id = ? order by position asc"), tagID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var layers []LayerInfo
+	for rows.Next() {
+		var layer LayerInfo
+		if err := rows.Scan(&layer.Digest, &layer.Size); err != nil {
+			continue
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+func (s *sqlStore) SetTagStatus(repository, tag, context, status, description, targetURL string) error {
+	var exists int
+	row := s.db.QueryRow(s.q("select 1 from tags where repository=? and tag=? limit 1"), repository, tag)
+	if err := row.Scan(&exists); err != nil {
+		if err == sql.ErrNoRows {
+			return sql.ErrNoRows
+		}
+		return err
+	}
+
+	if _, err := s.db.Exec(s.q(s.dialect.upsertTagStatus()),
+		repository, tag, context, status, description, targetURL, time.Now()); err != nil {
+		return err
+	}
+
+	// The "default" context also mirrors into the legacy tags.status/
+	// description/target_url columns, so GetPage's top-level Tag.Status
+	// (pre-dating per-context tag_statuses) keeps reflecting the same
+	// value it always has for callers that never adopted contexts.
+	if context == "default" {
+		_, err := s.db.Exec(s.q("update tags set status=?, description=?, target_url=? where repository=? and tag=?"),
+			status, description, targetURL, repository, tag)
+		return err
+	}
+	return nil
+}
+
+func (s *sqlStore) ListTagStatuses(repository, tag string) ([]TagStatus, error) {
+	rows, err := s.db.Query(s.q(
+		"select context, status, description, target_url, updated_at from tag_statuses where repository=? and tag=?"),
+		repository, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statuses []TagStatus
+	for rows.Next() {
+		var status TagStatus
+		if err := rows.Scan(&status.Context, &status.Status, &status.Description, &status.TargetURL, &status.UpdatedAt); err != nil {
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (s *sqlStore) UpdateEnrichment(tag Tag) error {
+	_, err := s.db.Exec(s.q(`update tags set size=?, architecture=?, os=?, author=?, created=?, media_type=?
+		where repository=? and tag=? and platform=?`),
+		tag.Size, tag.Architecture, tag.OS, tag.Author, tag.Created, tag.MediaType,
+		tag.Repository, tag.Tag, tag.Platform)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec(s.q("delete from tag_layers where tag_id = (select id from tags where repository=? and tag=? and platform=?)"),
+		tag.Repository, tag.Tag, tag.Platform); err != nil {
+		return err
+	}
+
+	for i, layer := range tag.Layers {
+		_, err := s.db.Exec(s.q(`insert into tag_layers(tag_id, position, digest, size)
+			values((select id from tags where repository=? and tag=? and platform=?), ?, ?, ?)`),
+			tag.Repository, tag.Tag, tag.Platform, i, layer.Digest, layer.Size)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) AppendEvent(event Event) error {
+	_, err := s.db.Exec(s.q("insert into events(repository, tag, digest, action, actor, timestamp) values(?,?,?,?,?,?)"),
+		event.Repository, event.Tag, event.Digest, event.Action, event.Actor, event.Timestamp)
+	return err
+}
+
+func (s *sqlStore) ListEvents(args EventQueryArgs) ([]Event, error) {
+	query := "select id, repository, tag, digest, action, actor, timestamp from events where 1=1"
+	var queryArgs []interface{}
+
+	if !args.Since.IsZero() {
+		query += " and timestamp >= ?"
+		queryArgs = append(queryArgs, args.Since)
+	}
+	if !args.Until.IsZero() {
+		query += " and timestamp <= ?"
+		queryArgs = append(queryArgs, args.Until)
+	}
+	if args.Repository != "" {
+		query += " and repository = ?"
+		queryArgs = append(queryArgs, args.Repository)
+	}
+	if args.Action != "" {
+		query += " and action = ?"
+		queryArgs = append(queryArgs, args.Action)
+	}
+	query += " order by timestamp asc"
+
+	rows, err := s.db.Query(s.q(query), queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		if err := rows.Scan(&event.ID, &event.Repository, &event.Tag, &event.Digest, &event.Action, &event.Actor, &event.Timestamp); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (s *sqlStore) PruneEvents(before int64) error {
+	_, err := s.db.Exec(s.q("delete from events where timestamp < ?"), time.Unix(before, 0))
+	return err
+}
+
+func (s *sqlStore) AddManifestListChild(tag Tag) error {
+	return s.AddTag(tag)
+}
+
+func (s *sqlStore) DeleteManifestList(repository, listDigest string) error {
+	_, err := s.db.Exec(s.q("delete from tags where repository=? and manifest_list_digest=?"), repository, listDigest)
+	return err
+}
+
+func (d dialect) upsertTagStatus() string {
+	switch d.name {
+	case "postgres":
+		return `insert into tag_statuses(repository, tag, context, status, description, target_url, updated_at)
+			values(?,?,?,?,?,?,?)
+			on conflict(repository, tag, context) do update set status=excluded.status, description=excluded.description,
+				target_url=excluded.target_url, updated_at=excluded.updated_at`
+	case "mysql":
+		return `insert into tag_statuses(repository, tag, context, status, description, target_url, updated_at)
+			values(?,?,?,?,?,?,?)
+			on duplicate key update status=values(status), description=values(description),
+				target_url=values(target_url), updated_at=values(updated_at)`
+	default:
+		return `replace into tag_statuses(repository, tag, context, status, description, target_url, updated_at) values(?,?,?,?,?,?,?)`
+	}
+}
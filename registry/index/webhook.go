@@ -0,0 +1,64 @@
+package index
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const webhookTimestampSkew = 5 * time.Minute
+
+// VerifyWebhookSignature checks an inbound tag-status PATCH against the
+// secret configured for its context, falling back to the default
+// (index.webhook_secret) when that context has no override.
+func (self *IndexService) VerifyWebhookSignature(context, signatureHeader, timestampHeader string, body []byte) error {
+	return VerifyWebhookSignature(self.secretForContext(context), signatureHeader, timestampHeader, body)
+}
+
+// WebhookSecretConfigured reports whether a secret is configured for the
+// given context (or the default), so callers can keep accepting unsigned
+// requests on installs that haven't opted into the HMAC scheme yet.
+func (self *IndexService) WebhookSecretConfigured(context string) bool {
+	return self.secretForContext(context) != ""
+}
+
+func (self *IndexService) secretForContext(context string) string {
+	if secret, ok := self.webhookSecrets[context]; ok && secret != "" {
+		return secret
+	}
+	return self.webhookSecrets["default"]
+}
+
+// VerifyWebhookSignature checks the X-Registry-Signature / X-Registry-Timestamp
+// pair CI integrations attach to tag-status PATCH requests against the
+// configured shared secret, rejecting stale or mismatched requests.
+func VerifyWebhookSignature(secret, signatureHeader, timestampHeader string, body []byte) error {
+	if secret == "" {
+		return fmt.Errorf("index: webhook secret not configured")
+	}
+
+	ts, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return fmt.Errorf("index: invalid X-Registry-Timestamp: %v", err)
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > webhookTimestampSkew || age < -webhookTimestampSkew {
+		return fmt.Errorf("index: stale webhook timestamp")
+	}
+
+	const prefix = "sha256="
+	if len(signatureHeader) <= len(prefix) || signatureHeader[:len(prefix)] != prefix {
+		return fmt.Errorf("index: malformed X-Registry-Signature")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestampHeader + "." + string(body)))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signatureHeader[len(prefix):])) {
+		return fmt.Errorf("index: webhook signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package index
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func sign(secret, timestampHeader string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestampHeader + "." + string(body)))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyWebhookSignatureValid(t *testing.T) {
+	body := []byte(`{"status":"success"}`)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	sig := sign("s3cr3t", ts, body)
+
+	if err := VerifyWebhookSignature("s3cr3t", sig, ts, body); err != nil {
+		t.Fatalf("VerifyWebhookSignature: %v", err)
+	}
+}
+
+func TestVerifyWebhookSignatureWrongSecret(t *testing.T) {
+	body := []byte(`{"status":"success"}`)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	sig := sign("s3cr3t", ts, body)
+
+	if err := VerifyWebhookSignature("other-secret", sig, ts, body); err == nil {
+		t.Fatal("expected a signature mismatch error")
+	}
+}
+
+func TestVerifyWebhookSignatureStaleTimestamp(t *testing.T) {
+	body := []byte(`{"status":"success"}`)
+	ts := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	sig := sign("s3cr3t", ts, body)
+
+	if err := VerifyWebhookSignature("s3cr3t", sig, ts, body); err == nil {
+		t.Fatal("expected a stale timestamp error")
+	}
+}
+
+func TestVerifyWebhookSignatureMissingSecret(t *testing.T) {
+	body := []byte(`{"status":"success"}`)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	sig := sign("s3cr3t", ts, body)
+
+	if err := VerifyWebhookSignature("", sig, ts, body); err == nil {
+		t.Fatal("expected an error when no secret is configured")
+	}
+}
+
+func TestVerifyWebhookSignatureMalformedHeader(t *testing.T) {
+	body := []byte(`{"status":"success"}`)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	if err := VerifyWebhookSignature("s3cr3t", "not-a-valid-signature", ts, body); err == nil {
+		t.Fatal("expected a malformed signature error")
+	}
+}
+
+func TestIndexServiceSecretForContextFallsBackToDefault(t *testing.T) {
+	srv := &IndexService{webhookSecrets: map[string]string{"default": "fallback-secret"}}
+	if got := srv.secretForContext("ci/build"); got != "fallback-secret" {
+		t.Fatalf("secretForContext: got %q, want %q", got, "fallback-secret")
+	}
+}
+
+func TestIndexServiceSecretForContextPrefersOverride(t *testing.T) {
+	srv := &IndexService{webhookSecrets: map[string]string{
+		"default":  "fallback-secret",
+		"ci/build": "build-secret",
+	}}
+	if got := srv.secretForContext("ci/build"); got != "build-secret" {
+		t.Fatalf("secretForContext: got %q, want %q", got, "build-secret")
+	}
+}